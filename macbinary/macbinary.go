@@ -0,0 +1,135 @@
+// Package macbinary reads the MacBinary file header used to carry a
+// classic Mac OS file's data fork, resource fork and Finder metadata
+// inside a single stream. It is format-agnostic: callers such as
+// samuel/go-macpaint check the Header's FileType/FileCreator themselves
+// and then read the data fork from the returned io.Reader.
+//
+// http://www.lazerware.com/formats/macbinary/macbinary_ii.html
+package macbinary
+
+import (
+	"io"
+)
+
+const headerSize = 128
+
+// An ErrFormat reports that the input is not a valid MacBinary header.
+type ErrFormat string
+
+func (e ErrFormat) Error() string {
+	return "macbinary: invalid format: " + string(e)
+}
+
+// Options configures how Header data is validated while decoding.
+type Options struct {
+	// SkipCRC disables verification of the header CRC. Many real-world
+	// MacBinary files carry a broken CRC, so callers that tolerate
+	// that should set this.
+	SkipCRC bool
+}
+
+// A Header is a parsed MacBinary header.
+type Header struct {
+	FileName           string // Name of the file
+	FileType           string // Type of Macintosh file
+	FileCreator        string // ID of program that created file
+	FileFlags          byte   // File attribute flags
+	FileVertPos        uint16 // File vertical position in window
+	FileHorzPos        uint16 // File horizontal position in window
+	WindowID           uint16 // Window or folder ID
+	Protected          bool   // File protection
+	SizeOfDataFork     uint32 // Size of file data fork in bytes
+	SizeOfResourceFork uint32 // Size of file resource fork in bytes
+	CreationStamp      uint32 // Time and date file created
+	ModificationStamp  uint32 // Time and date file last modified
+	GetInfoLength      uint16 // GetInfo message length
+	// The following fields were added for MacBinary II
+	FinderFlags      uint16 // Finder flags
+	UnpackedLength   uint32 // Total unpacked file length
+	SecondHeadLength uint16 // Length of secondary header
+	UploadVersion    byte   // MacBinary version used with uploader
+	ReadVersion      byte   // MacBinary version needed to read
+	CRCValue         uint16 // CRC value of the header's first 124 bytes
+}
+
+// isMacBinaryII reports whether h claims to be a MacBinary II header,
+// which is the variant that carries a checkable CRC.
+func (h Header) isMacBinaryII() bool {
+	return h.UploadVersion == 0x81 && h.ReadVersion == 0x81
+}
+
+// Decode reads a MacBinary header from r and returns it along with a
+// reader positioned at the start of the data fork that follows it.
+func Decode(r io.Reader) (Header, io.Reader, error) {
+	return DecodeWithOptions(r, Options{})
+}
+
+// DecodeWithOptions reads a MacBinary header from r as Decode does, using
+// opts to control validation.
+func DecodeWithOptions(r io.Reader, opts Options) (Header, io.Reader, error) {
+	var h Header
+	var buf [headerSize]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return h, nil, err
+	}
+	if buf[0] != 0 {
+		return h, nil, ErrFormat("expected version 0")
+	}
+	if buf[1] > 63 {
+		return h, nil, ErrFormat("invalid filename length")
+	}
+	h.FileName = string(buf[2 : 2+buf[1]])
+	h.FileType = string(buf[65:69])
+	h.FileCreator = string(buf[69:73])
+	h.FileFlags = buf[73]
+	h.FileVertPos = decodeUint16(buf[75:77])
+	h.FileHorzPos = decodeUint16(buf[77:79])
+	h.WindowID = decodeUint16(buf[79:81])
+	h.Protected = buf[81] == 1
+	h.SizeOfDataFork = decodeUint32(buf[83:87])
+	h.SizeOfResourceFork = decodeUint32(buf[87:91])
+	h.CreationStamp = decodeUint32(buf[91:95])
+	h.ModificationStamp = decodeUint32(buf[95:99])
+	h.GetInfoLength = decodeUint16(buf[99:101])
+	h.FinderFlags = decodeUint16(buf[101:103])
+	h.UnpackedLength = decodeUint32(buf[117:121])
+	h.SecondHeadLength = decodeUint16(buf[121:123])
+	h.UploadVersion = buf[123]
+	h.ReadVersion = buf[124]
+	h.CRCValue = decodeUint16(buf[125:127])
+
+	if !opts.SkipCRC && h.isMacBinaryII() {
+		if CRC(buf[:124]) != h.CRCValue {
+			return h, nil, ErrFormat("bad MacBinary CRC")
+		}
+	}
+	return h, r, nil
+}
+
+// CRC computes the CRC-CCITT (XMODEM) checksum MacBinary headers use:
+// polynomial 0x1021, initial value 0, no reflection, no xor-out.
+func CRC(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func decodeUint16(b []byte) uint16 {
+	return (uint16(b[0]) << 8) | uint16(b[1])
+}
+
+func decodeUint32(b []byte) uint32 {
+	return (uint32(b[0]) << 24) | (uint32(b[1]) << 16) | (uint32(b[2]) << 8) | uint32(b[3])
+}
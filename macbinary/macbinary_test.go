@@ -0,0 +1,51 @@
+package macbinary
+
+import (
+	"bytes"
+	"testing"
+)
+
+func validHeader(t *testing.T) [headerSize]byte {
+	t.Helper()
+	var buf [headerSize]byte
+	buf[1] = 5
+	copy(buf[2:7], "test\x00")
+	copy(buf[65:69], "TEXT")
+	copy(buf[69:73], "ttxt")
+	buf[123] = 0x81
+	buf[124] = 0x81
+	v := CRC(buf[:124])
+	buf[125] = byte(v >> 8)
+	buf[126] = byte(v)
+	return buf
+}
+
+func TestDecode(t *testing.T) {
+	buf := validHeader(t)
+	h, rest, err := Decode(bytes.NewReader(buf[:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.FileType != "TEXT" || h.FileCreator != "ttxt" {
+		t.Fatalf("unexpected header: %+v", h)
+	}
+	if rest == nil {
+		t.Fatal("expected a non-nil data fork reader")
+	}
+}
+
+func TestDecodeBadCRC(t *testing.T) {
+	buf := validHeader(t)
+	buf[125] ^= 0xFF
+	if _, _, err := Decode(bytes.NewReader(buf[:])); err == nil {
+		t.Fatal("expected an error for a bad CRC")
+	}
+}
+
+func TestDecodeWithOptionsSkipCRC(t *testing.T) {
+	buf := validHeader(t)
+	buf[125] ^= 0xFF
+	if _, _, err := DecodeWithOptions(bytes.NewReader(buf[:]), Options{SkipCRC: true}); err != nil {
+		t.Fatalf("expected SkipCRC to tolerate a bad CRC, got %v", err)
+	}
+}
@@ -11,16 +11,24 @@ package macpaint
 
 import (
 	"bufio"
+	"bytes"
 	"image"
 	"image/color"
 	"io"
 	"io/ioutil"
+
+	"samuel/go-macpaint/macbinary"
 )
 
 const (
-	width    = 576
-	height   = 720
-	fileType = "PNTG"
+	width       = 576
+	height      = 720
+	fileType    = "PNTG"
+	creatorType = "MPNT"
+
+	// numPatterns is the number of built-in 8x8 monochrome brush
+	// patterns MacPaint stores between the header and the RLE bitmap.
+	numPatterns = 38
 )
 
 // file flag bits
@@ -37,32 +45,26 @@ const (
 
 type decoder struct {
 	r        io.Reader
-	buf      []byte
 	noHeader bool
-	header   header
-}
-
-type header struct {
-	fileName           string
-	fileType           string // Type of Macintosh file
-	fileCreator        string // ID of program that created file
-	fileFlags          byte   // File attribute flags
-	fileVertPos        uint16 // File vertical position in window
-	fileHorzPos        uint16 // File horizontal position in window
-	windowID           uint16 // Window or folder ID
-	protected          bool   // File protection
-	sizeOfDataFork     uint32 // Size of file data fork in bytes
-	sizeOfResourceFork uint32 // Size of file resource fork in bytes
-	creationStamp      uint32 // Time and date file created
-	modificationStamp  uint32 // Time and date file last modified
-	getInfoLength      uint16 // GetInfo message length
-	// The following fields were added for MacBinary II
-	finderFlags      uint16 // Finder flags
-	unpackedLength   uint32 // Total unpacked file length
-	secondHeadLength uint16 // Length of secondary header
-	uploadVersion    byte   // MacBinary version used with uploader
-	readVersion      byte   // MacBinary version needed to read
-	crcValue         uint16 // CRC value of previous 124 bytes
+	header   macbinary.Header
+	opts     DecodeOptions
+}
+
+// palette is the 1-bpp color.Palette used by Paletted images, index 0 is
+// white and index 1 is black, matching MacPaint's own bit sense where a
+// set bit is black.
+var palette = color.Palette{color.White, color.Black}
+
+// DecodeOptions configures how DecodeWithOptions and DecodeConfigWithOptions
+// decode a MacPaint image.
+type DecodeOptions struct {
+	// AsPaletted selects an *image.Paletted against the 2-color
+	// palette, instead of the default *image.Gray.
+	AsPaletted bool
+
+	// SkipCRC disables verification of the MacBinary header CRC, for
+	// the many real-world files that carry a broken one.
+	SkipCRC bool
 }
 
 // A ErrFormat reports that the input is not a valid MacPaint.
@@ -84,9 +86,16 @@ func init() {
 }
 
 // Decode reads a MacPaint image from r and returns it as an image.Image.
-// The type of Image returned depends on the MacPaint contents.
+// The returned image is an *image.Gray; use DecodeWithOptions to decode
+// as an *image.Paletted instead.
 func Decode(r io.Reader) (image.Image, error) {
-	d, err := newDecoder(r)
+	return DecodeWithOptions(r, DecodeOptions{})
+}
+
+// DecodeWithOptions reads a MacPaint image from r as Decode does, using
+// opts to select the returned image type.
+func DecodeWithOptions(r io.Reader, opts DecodeOptions) (image.Image, error) {
+	d, err := newDecoder(r, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -97,89 +106,213 @@ func Decode(r io.Reader) (image.Image, error) {
 	return img, nil
 }
 
+// Patterns reads a MacPaint file from r and returns its 38 built-in 8x8
+// monochrome brush patterns, without decoding the bitmap.
+func Patterns(r io.Reader) ([numPatterns]*image.Gray, error) {
+	d, err := newDecoder(r, DecodeOptions{})
+	if err != nil {
+		return [numPatterns]*image.Gray{}, err
+	}
+	if err := d.skipToData(); err != nil {
+		return [numPatterns]*image.Gray{}, err
+	}
+	return d.readPatterns()
+}
+
+// DecodeWithPatterns reads a MacPaint image from r in a single pass,
+// returning both the decoded bitmap and the 38 brush patterns stored
+// alongside it.
+func DecodeWithPatterns(r io.Reader) (image.Image, [numPatterns]*image.Gray, error) {
+	d, err := newDecoder(r, DecodeOptions{})
+	if err != nil {
+		return nil, [numPatterns]*image.Gray{}, err
+	}
+	if err := d.skipToData(); err != nil {
+		return nil, [numPatterns]*image.Gray{}, err
+	}
+	pats, err := d.readPatterns()
+	if err != nil {
+		return nil, [numPatterns]*image.Gray{}, err
+	}
+	img, err := d.decodeBitmap()
+	if err != nil {
+		return nil, [numPatterns]*image.Gray{}, err
+	}
+	return img, pats, nil
+}
+
 // DecodeConfig returns the color model and dimensions of a MacPaint image
 // without decoding the entire image.
 func DecodeConfig(r io.Reader) (image.Config, error) {
+	return DecodeConfigWithOptions(r, DecodeOptions{})
+}
+
+// DecodeConfigWithOptions returns the color model and dimensions of a
+// MacPaint image as DecodeConfig does, honoring opts.AsPaletted.
+func DecodeConfigWithOptions(r io.Reader, opts DecodeOptions) (image.Config, error) {
+	cm := color.Model(color.GrayModel)
+	if opts.AsPaletted {
+		cm = palette
+	}
 	return image.Config{
-		ColorModel: color.GrayModel,
+		ColorModel: cm,
 		Width:      width,
 		Height:     height,
 	}, nil
 }
 
-func newDecoder(r io.Reader) (*decoder, error) {
-	d := &decoder{
-		r:   r,
-		buf: make([]byte, 512),
-	}
-	if err := d.readHeader(); err != nil {
+// dataMarker is the 4-byte version marker that opens a MacPaint data fork.
+// Its presence as the very first bytes of the stream, instead of a valid
+// MacBinary header, is how the decoder tells the two variants apart.
+var dataMarker = []byte{0, 0, 0, 2}
+
+func newDecoder(r io.Reader, opts DecodeOptions) (*decoder, error) {
+	d := &decoder{opts: opts}
+	br := bufio.NewReader(r)
+	peeked, err := br.Peek(len(dataMarker))
+	if err != nil {
 		if err == io.EOF {
 			err = io.ErrUnexpectedEOF
 		}
 		return nil, err
 	}
+	if bytes.Equal(peeked, dataMarker) {
+		d.noHeader = true
+		if _, err := br.Discard(len(dataMarker)); err != nil {
+			return nil, err
+		}
+		d.r = br
+		return d, nil
+	}
+	hdr, rest, err := macbinary.DecodeWithOptions(br, macbinary.Options{SkipCRC: opts.SkipCRC})
+	if err != nil {
+		return nil, err
+	}
+	if hdr.FileType != fileType {
+		return nil, ErrFormat("invalid file type")
+	}
+	d.header = hdr
+	d.r = rest
 	return d, nil
 }
 
-func (d *decoder) readHeader() error {
-	if _, err := io.ReadFull(d.r, d.buf[:4]); err != nil {
-		return err
+func (d *decoder) decode() (image.Image, error) {
+	if err := d.skipToData(); err != nil {
+		return nil, err
 	}
-	if d.buf[0] == 0 && d.buf[1] == 0 && d.buf[2] == 0 && d.buf[3] == 2 {
-		d.noHeader = true
+	if _, err := d.readPatterns(); err != nil {
+		return nil, err
+	}
+	return d.decodeBitmap()
+}
+
+// skipToData consumes the data-fork version marker that precedes the
+// pattern block, when a MacBinary header was present.
+func (d *decoder) skipToData() error {
+	if d.noHeader {
 		return nil
 	}
-	if _, err := io.ReadFull(d.r, d.buf[4:128]); err != nil {
+	var marker [4]byte
+	if _, err := io.ReadFull(d.r, marker[:]); err != nil {
 		return err
 	}
-	if d.buf[0] != 0 {
-		return ErrFormat("expected version 0")
-	}
-	if d.buf[1] > 63 {
-		return ErrFormat("invalid filename length")
-	}
-	d.header.fileName = string(d.buf[2 : 2+d.buf[1]])
-	d.header.fileType = string(d.buf[65:69])
-	if d.header.fileType != fileType {
-		return ErrFormat("invalid file type")
-	}
-	d.header.fileCreator = string(d.buf[69:73])
-	d.header.fileFlags = d.buf[73]
-	d.header.fileVertPos = decodeUint16(d.buf[75:77])
-	d.header.fileHorzPos = decodeUint16(d.buf[77:79])
-	d.header.windowID = decodeUint16(d.buf[79:81])
-	d.header.protected = d.buf[81] == 1
-	d.header.sizeOfDataFork = decodeUint32(d.buf[83:87])
-	d.header.sizeOfResourceFork = decodeUint32(d.buf[87:91])
-	d.header.creationStamp = decodeUint32(d.buf[65+26 : 65+30])
-	d.header.modificationStamp = decodeUint32(d.buf[65+30 : 65+34])
-	d.header.getInfoLength = decodeUint16(d.buf[65+34 : 65+36])
-	d.header.finderFlags = decodeUint16(d.buf[65+36 : 65+38])
-	d.header.unpackedLength = decodeUint32(d.buf[65+52 : 65+56])
-	d.header.secondHeadLength = decodeUint16(d.buf[65+56 : 65+58])
-	d.header.uploadVersion = d.buf[65+58]
-	d.header.readVersion = d.buf[65+59]
-	d.header.crcValue = decodeUint16(d.buf[65+60 : 65+62])
+	// TODO: not sure why this differs between some files
+	// if !bytes.Equal(marker[:], dataMarker) {
+	// 	return ErrFormat("missing data marker")
+	// }
 	return nil
 }
 
-func (d *decoder) decode() (image.Image, error) {
-	if !d.noHeader {
-		if _, err := io.ReadFull(d.r, d.buf[:4]); err != nil {
-			return nil, err
+// readPatterns reads the 304-byte pattern block and the 204 bytes of
+// padding that follow it, leaving d.r positioned at the start of the
+// PackBits-compressed bitmap.
+func (d *decoder) readPatterns() ([numPatterns]*image.Gray, error) {
+	var pats [numPatterns]*image.Gray
+	var buf [numPatterns * 8]byte
+	if _, err := io.ReadFull(d.r, buf[:]); err != nil {
+		return pats, err
+	}
+	pats = decodePatternBlock(buf)
+	if _, err := io.CopyN(ioutil.Discard, d.r, 204); err != nil {
+		return pats, err
+	}
+	return pats, nil
+}
+
+// decodePatternBlock converts the raw 304-byte pattern block into the 38
+// 8x8 monochrome patterns it encodes.
+func decodePatternBlock(buf [numPatterns * 8]byte) [numPatterns]*image.Gray {
+	var pats [numPatterns]*image.Gray
+	for i := range pats {
+		p := image.NewGray(image.Rect(0, 0, 8, 8))
+		for row := 0; row < 8; row++ {
+			b := buf[i*8+row]
+			for col := 0; col < 8; col++ {
+				if b&(0x80>>uint(col)) != 0 {
+					p.SetGray(col, row, color.Gray{Y: 0})
+				} else {
+					p.SetGray(col, row, color.Gray{Y: 255})
+				}
+			}
 		}
-		// TODO: not sure why this differs between some files
-		// if d.buf[0] != 0 || d.buf[1] != 0 || d.buf[2] != 0 || d.buf[3] != 2 {
-		// 	return nil, ErrFormat("missing data marker")
-		// }
+		pats[i] = p
 	}
-	// 304 for pattern data, 204 for padding
-	if _, err := io.CopyN(ioutil.Discard, d.r, 304+204); err != nil {
+	return pats
+}
+
+// decodeBitmap decompresses the PackBits-encoded bitmap into an
+// *image.Paletted (when d.opts.AsPaletted) or, by default, an *image.Gray.
+func (d *decoder) decodeBitmap() (image.Image, error) {
+	packed, err := d.decodePackedBitmap()
+	if err != nil {
 		return nil, err
 	}
-	rd := bufio.NewReader(d.r)
+	if d.opts.AsPaletted {
+		// image.Paletted addresses Pix one byte per pixel, so the
+		// packed bits are expanded to palette indices here rather
+		// than handed to Paletted as-is.
+		img := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x += 8 {
+				b := packed[y*bytesPerRow+x/8]
+				for i := 0; i < 8; i++ {
+					o := img.PixOffset(x+i, y)
+					if b&0x80 != 0 {
+						img.Pix[o] = 1
+					} else {
+						img.Pix[o] = 0
+					}
+					b <<= 1
+				}
+			}
+		}
+		return img, nil
+	}
 	img := image.NewGray(image.Rect(0, 0, width, height))
-	for o := 0; o < len(img.Pix); {
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x += 8 {
+			b := packed[y*bytesPerRow+x/8]
+			for i := 0; i < 8; i++ {
+				o := img.PixOffset(x+i, y)
+				if b&0x80 != 0 {
+					img.Pix[o] = 0
+				} else {
+					img.Pix[o] = 255
+				}
+				b <<= 1
+			}
+		}
+	}
+	return img, nil
+}
+
+// decodePackedBitmap decompresses the PackBits-encoded bitmap into its
+// on-disk 1-bpp packed form: bytesPerRow bytes per scan line, MSB is the
+// leftmost pixel, a set bit is black.
+func (d *decoder) decodePackedBitmap() ([]byte, error) {
+	rd := bufio.NewReader(d.r)
+	packed := make([]byte, bytesPerRow*height)
+	for o := 0; o < len(packed); {
 		n, err := rd.ReadByte()
 		if err != nil {
 			return nil, err
@@ -190,49 +323,23 @@ func (d *decoder) decode() (image.Image, error) {
 			if err != nil {
 				return nil, err
 			}
+			if o+int(n) > len(packed) {
+				return nil, ErrFormat("overflow decoding RLE")
+			}
 			for i := 0; i < int(n); i++ {
-				c := b
-				for j := 0; j < 8; j++ {
-					if o == len(img.Pix) {
-						return nil, ErrFormat("overflow decoding RLE")
-					}
-					if c&0x80 != 0 {
-						img.Pix[o] = 0
-					} else {
-						img.Pix[o] = 255
-					}
-					o++
-					c <<= 1
-				}
+				packed[o] = b
+				o++
 			}
 		} else {
 			n++
-			if _, err := io.ReadFull(rd, d.buf[:int(n)]); err != nil {
-				return nil, err
+			if o+int(n) > len(packed) {
+				return nil, ErrFormat("overflow decoding RLE")
 			}
-			for _, b := range d.buf[:int(n)] {
-				for j := 0; j < 8; j++ {
-					if o == len(img.Pix) {
-						return nil, ErrFormat("overflow decoding RLE")
-					}
-					if b&0x80 != 0 {
-						img.Pix[o] = 0
-					} else {
-						img.Pix[o] = 255
-					}
-					o++
-					b <<= 1
-				}
+			if _, err := io.ReadFull(rd, packed[o:o+int(n)]); err != nil {
+				return nil, err
 			}
+			o += int(n)
 		}
 	}
-	return img, nil
-}
-
-func decodeUint16(b []byte) uint16 {
-	return (uint16(b[0]) << 8) | uint16(b[1])
-}
-
-func decodeUint32(b []byte) uint32 {
-	return (uint32(b[0]) << 24) | (uint32(b[1]) << 16) | (uint32(b[2]) << 8) | uint32(b[3])
+	return packed, nil
 }
@@ -0,0 +1,89 @@
+package macpaint
+
+import (
+	"image"
+	"io"
+)
+
+// defaultPatternBits holds a palette of 38 8x8 monochrome brush patterns,
+// one 8-byte row-major bitmap per pattern (MSB is the leftmost pixel, set
+// bit is black), in the on-disk layout of a MacPaint pattern block. It is
+// a representative placeholder palette, not verified against a real
+// MacPaint document or ROM resource — there is no fixture in this repo
+// to check it against. Treat DefaultPatterns as "some valid 38-pattern
+// palette", not as the bit-exact set MacPaint itself ships.
+var defaultPatternBits = [numPatterns * 8]byte{
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // 0: white
+	0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, // 1
+	0x22, 0x22, 0x22, 0x22, 0x22, 0x22, 0x22, 0x22, // 2
+	0x55, 0xAA, 0x55, 0xAA, 0x55, 0xAA, 0x55, 0xAA, // 3: 50% gray
+	0x88, 0x88, 0x88, 0x88, 0x88, 0x88, 0x88, 0x88, // 4
+	0xAA, 0x55, 0xAA, 0x55, 0xAA, 0x55, 0xAA, 0x55, // 5: 50% gray, inverted
+	0x00, 0x22, 0x00, 0x88, 0x00, 0x22, 0x00, 0x88, // 6
+	0x88, 0x00, 0x22, 0x00, 0x88, 0x00, 0x22, 0x00, // 7
+	0xFF, 0x00, 0x00, 0x00, 0xFF, 0x00, 0x00, 0x00, // 8: horizontal lines
+	0x00, 0x00, 0x00, 0xFF, 0x00, 0x00, 0x00, 0xFF, // 9: horizontal lines
+	0x88, 0x88, 0xFF, 0x88, 0x88, 0x88, 0xFF, 0x88, // 10
+	0x80, 0x80, 0x80, 0xFF, 0x08, 0x08, 0x08, 0xFF, // 11
+	0x77, 0x77, 0x77, 0x77, 0x77, 0x77, 0x77, 0x77, // 12
+	0xEE, 0xEE, 0xEE, 0xEE, 0xEE, 0xEE, 0xEE, 0xEE, // 13
+	0x99, 0x99, 0x99, 0x99, 0x99, 0x99, 0x99, 0x99, // 14
+	0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, // 15
+	0x80, 0x00, 0x08, 0x00, 0x80, 0x00, 0x08, 0x00, // 16: sparse dots
+	0x00, 0x08, 0x00, 0x80, 0x00, 0x08, 0x00, 0x80, // 17
+	0x81, 0x42, 0x24, 0x18, 0x18, 0x24, 0x42, 0x81, // 18: diamond
+	0x7E, 0xBD, 0xDB, 0xE7, 0xE7, 0xDB, 0xBD, 0x7E, // 19: inverted diamond
+	0xC3, 0x66, 0x3C, 0x18, 0x18, 0x3C, 0x66, 0xC3, // 20
+	0x01, 0x02, 0x04, 0x08, 0x10, 0x20, 0x40, 0x80, // 21: diagonal stripes
+	0x80, 0x40, 0x20, 0x10, 0x08, 0x04, 0x02, 0x01, // 22: diagonal stripes
+	0x03, 0x06, 0x0C, 0x18, 0x30, 0x60, 0xC0, 0x81, // 23
+	0xC0, 0x60, 0x30, 0x18, 0x0C, 0x06, 0x03, 0x81, // 24
+	0x18, 0x3C, 0x7E, 0xFF, 0xFF, 0x7E, 0x3C, 0x18, // 25: filled diamond
+	0xFF, 0xFF, 0x00, 0x00, 0xFF, 0xFF, 0x00, 0x00, // 26: thick horizontal bands
+	0x0F, 0x0F, 0x0F, 0x0F, 0xF0, 0xF0, 0xF0, 0xF0, // 27
+	0xF0, 0xF0, 0xF0, 0xF0, 0x0F, 0x0F, 0x0F, 0x0F, // 28
+	0x33, 0x33, 0xCC, 0xCC, 0x33, 0x33, 0xCC, 0xCC, // 29: checkerboard
+	0xCC, 0xCC, 0x33, 0x33, 0xCC, 0xCC, 0x33, 0x33, // 30: checkerboard, inverted
+	0x41, 0x00, 0x14, 0x00, 0x41, 0x00, 0x14, 0x00, // 31
+	0x00, 0x41, 0x00, 0x14, 0x00, 0x41, 0x00, 0x14, // 32
+	0xAA, 0x00, 0xAA, 0x00, 0xAA, 0x00, 0xAA, 0x00, // 33
+	0x00, 0xAA, 0x00, 0xAA, 0x00, 0xAA, 0x00, 0xAA, // 34
+	0x10, 0x28, 0x44, 0x82, 0x82, 0x44, 0x28, 0x10, // 35
+	0xEF, 0xEF, 0xEF, 0xEF, 0xFE, 0xFE, 0xFE, 0xFE, // 36
+	0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, // 37: black
+}
+
+// DefaultPatterns returns the built-in palette of 38 brush patterns.
+// Encoder falls back to it, pattern by pattern, for any entry left unset
+// in Encoder.Patterns.
+func DefaultPatterns() [numPatterns]*image.Gray {
+	return decodePatternBlock(defaultPatternBits)
+}
+
+// writePatternBlock writes the 304-byte pattern block for pats. Any nil
+// entry (as left by the Encoder.Patterns zero value, or a partially
+// populated array) is replaced with the corresponding DefaultPatterns
+// entry.
+func writePatternBlock(w io.Writer, pats [numPatterns]*image.Gray) error {
+	defaults := DefaultPatterns()
+	for i, p := range pats {
+		if p == nil {
+			pats[i] = defaults[i]
+		}
+	}
+	var buf [numPatterns * 8]byte
+	for i, p := range pats {
+		for row := 0; row < 8; row++ {
+			var b byte
+			for col := 0; col < 8; col++ {
+				b <<= 1
+				if p.GrayAt(col, row).Y == 0 {
+					b |= 1
+				}
+			}
+			buf[i*8+row] = b
+		}
+	}
+	_, err := w.Write(buf[:])
+	return err
+}
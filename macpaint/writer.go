@@ -0,0 +1,256 @@
+package macpaint
+
+import (
+	"bufio"
+	"image"
+	"image/draw"
+	"io"
+
+	"samuel/go-macpaint/macbinary"
+)
+
+// A Ditherer selects how a continuous-tone image.Image is reduced to the
+// 1-bpp pixels MacPaint requires.
+type Ditherer int
+
+const (
+	// NoDither thresholds each pixel independently at 50% gray.
+	NoDither Ditherer = iota
+	// FloydSteinberg dithers using Floyd-Steinberg error diffusion.
+	FloydSteinberg
+)
+
+// bytesPerRow is the number of packed, 1-bpp bytes in a single 576px scan
+// line.
+const bytesPerRow = width / 8
+
+// An Encoder configures how an image.Image is written as a MacPaint file.
+// The zero value is a ready to use Encoder that writes no MacBinary header
+// and thresholds the source image instead of dithering it.
+type Encoder struct {
+	// Ditherer selects how the source image is reduced to 1-bpp.
+	Ditherer Ditherer
+
+	// WriteHeader, if true, prepends a MacBinary header to the output
+	// so the result is a complete, transferable MacBinary file rather
+	// than a bare data fork.
+	WriteHeader bool
+
+	// FileName is recorded in the MacBinary header when WriteHeader is
+	// true. It is ignored otherwise.
+	FileName string
+
+	// Patterns is written as the document's 38 brush patterns. Any nil
+	// entry, including the zero value's all-nil array, falls back to
+	// the corresponding DefaultPatterns entry.
+	Patterns [numPatterns]*image.Gray
+}
+
+// Encode writes the image m to w in MacPaint format using default Encoder
+// options: no MacBinary header, thresholded rather than dithered.
+func Encode(w io.Writer, m image.Image) error {
+	var e Encoder
+	return e.Encode(w, m)
+}
+
+// Encode writes the image m to w in MacPaint format.
+func (e *Encoder) Encode(w io.Writer, m image.Image) error {
+	bits := e.toBitmap(m)
+
+	bw := bufio.NewWriter(w)
+	if e.WriteHeader {
+		if err := writeMacBinaryHeader(bw, e.FileName, bits); err != nil {
+			return err
+		}
+	}
+	// Data fork version marker: when there is no MacBinary header these
+	// are the first four bytes of the file, which is how the decoder
+	// tells the two variants apart.
+	if _, err := bw.Write([]byte{0, 0, 0, 2}); err != nil {
+		return err
+	}
+	if err := writePatternBlock(bw, e.Patterns); err != nil {
+		return err
+	}
+	if _, err := bw.Write(make([]byte, 204)); err != nil {
+		return err
+	}
+	for y := 0; y < height; y++ {
+		off := y * bytesPerRow
+		if err := packBitsEncodeLine(bw, bits[off:off+bytesPerRow]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// toBitmap thresholds or dithers m into a 576x720 1-bpp bitmap, padding or
+// cropping it to the fixed MacPaint canvas size. The result is packed
+// row-major, bytesPerRow bytes per scan line, MSB is the leftmost pixel,
+// a set bit means black.
+func (e *Encoder) toBitmap(m image.Image) []byte {
+	canvas := image.NewGray(image.Rect(0, 0, width, height))
+	draw.Draw(canvas, canvas.Bounds(), image.White, image.Point{}, draw.Src)
+	// Normalize to m's own origin: m.Bounds() may not start at (0,0) (as
+	// with img.SubImage(r)), and drawing into it directly would treat
+	// that offset as a literal canvas position instead of placing m's
+	// top-left at the canvas origin.
+	dr := image.Rectangle{Max: m.Bounds().Size()}.Intersect(canvas.Bounds())
+	draw.Draw(canvas, dr, m, m.Bounds().Min, draw.Src)
+
+	switch e.Ditherer {
+	case FloydSteinberg:
+		floydSteinbergDither(canvas)
+	default:
+		threshold(canvas)
+	}
+
+	packed := make([]byte, bytesPerRow*height)
+	for y := 0; y < height; y++ {
+		row := canvas.Pix[canvas.PixOffset(0, y):]
+		poff := y * bytesPerRow
+		for x := 0; x < width; x += 8 {
+			var b byte
+			for i := 0; i < 8; i++ {
+				b <<= 1
+				if row[x+i] == 0 {
+					b |= 1
+				}
+			}
+			packed[poff+x/8] = b
+		}
+	}
+	return packed
+}
+
+// threshold reduces g to black (0) and white (255) at 50% gray in place.
+func threshold(g *image.Gray) {
+	for i, v := range g.Pix {
+		if v < 128 {
+			g.Pix[i] = 0
+		} else {
+			g.Pix[i] = 255
+		}
+	}
+}
+
+// floydSteinbergDither reduces g to black (0) and white (255) in place
+// using Floyd-Steinberg error diffusion.
+func floydSteinbergDither(g *image.Gray) {
+	w, h := g.Bounds().Dx(), g.Bounds().Dy()
+	errs := make([]int32, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*w + x
+			v := int32(g.Pix[g.PixOffset(x, y)]) + errs[i]
+			var quant int32
+			if v < 128 {
+				g.Pix[g.PixOffset(x, y)] = 0
+			} else {
+				g.Pix[g.PixOffset(x, y)] = 255
+				quant = 255
+			}
+			e := v - quant
+			if x+1 < w {
+				errs[i+1] += e * 7 / 16
+			}
+			if y+1 < h {
+				if x > 0 {
+					errs[i+w-1] += e * 3 / 16
+				}
+				errs[i+w] += e * 5 / 16
+				if x+1 < w {
+					errs[i+w+1] += e * 1 / 16
+				}
+			}
+		}
+	}
+}
+
+// packBitsEncodeLine compresses a single scan line with Apple PackBits.
+// Runs never cross scan-line boundaries, so this is called once per line.
+func packBitsEncodeLine(w *bufio.Writer, line []byte) error {
+	n := len(line)
+	for i := 0; i < n; {
+		runLen := 1
+		for i+runLen < n && runLen < 128 && line[i+runLen] == line[i] {
+			runLen++
+		}
+		if runLen >= 2 {
+			if err := w.WriteByte(byte(257 - runLen)); err != nil {
+				return err
+			}
+			if err := w.WriteByte(line[i]); err != nil {
+				return err
+			}
+			i += runLen
+			continue
+		}
+		litStart := i
+		i++
+		for i < n && i-litStart < 128 {
+			if i+1 < n && line[i] == line[i+1] {
+				break
+			}
+			i++
+		}
+		if err := w.WriteByte(byte(i - litStart - 1)); err != nil {
+			return err
+		}
+		if _, err := w.Write(line[litStart:i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeMacBinaryHeader writes the 128-byte MacBinary header for a MacPaint
+// data fork wrapping the given packed bitmap.
+func writeMacBinaryHeader(w io.Writer, fileName string, bits []byte) error {
+	var buf [128]byte
+	if len(fileName) > 63 {
+		fileName = fileName[:63]
+	}
+	buf[1] = byte(len(fileName))
+	copy(buf[2:2+len(fileName)], fileName)
+	copy(buf[65:69], fileType)
+	copy(buf[69:73], creatorType)
+	encodeUint32(buf[83:87], uint32(4+304+204+packedSize(bits)))
+	buf[123] = 0x81 // uploadVersion: MacBinary II
+	buf[124] = 0x81 // readVersion: MacBinary II
+	encodeUint16(buf[125:127], macbinary.CRC(buf[:124]))
+	_, err := w.Write(buf[:])
+	return err
+}
+
+// packedSize returns the size, in bytes, of the PackBits-compressed form of
+// the packed bitmap bits.
+func packedSize(bits []byte) int {
+	var cw countingWriter
+	bw := bufio.NewWriter(&cw)
+	for y := 0; y < height; y++ {
+		off := y * bytesPerRow
+		packBitsEncodeLine(bw, bits[off:off+bytesPerRow])
+	}
+	bw.Flush()
+	return cw.n
+}
+
+type countingWriter struct{ n int }
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += len(p)
+	return len(p), nil
+}
+
+func encodeUint16(b []byte, v uint16) {
+	b[0] = byte(v >> 8)
+	b[1] = byte(v)
+}
+
+func encodeUint32(b []byte, v uint32) {
+	b[0] = byte(v >> 24)
+	b[1] = byte(v >> 16)
+	b[2] = byte(v >> 8)
+	b[3] = byte(v)
+}
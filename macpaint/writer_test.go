@@ -0,0 +1,205 @@
+package macpaint
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if (x/8+y/8)%2 == 0 {
+				src.SetGray(x, y, color.Gray{Y: 0})
+			} else {
+				src.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotGray, ok := got.(*image.Gray)
+	if !ok {
+		t.Fatalf("Decode returned %T, want *image.Gray", got)
+	}
+	if !bytes.Equal(gotGray.Pix, src.Pix) {
+		t.Fatal("round-tripped image does not match source")
+	}
+}
+
+func TestEncodeNormalizesSubImageOrigin(t *testing.T) {
+	full := image.NewGray(image.Rect(0, 0, 500, 500))
+	draw.Draw(full, full.Bounds(), image.White, image.Point{}, draw.Src)
+	black := full.SubImage(image.Rect(100, 100, 400, 400)).(*image.Gray)
+	draw.Draw(black, black.Bounds(), image.Black, image.Point{}, draw.Src)
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, black); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotGray := got.(*image.Gray)
+	if gotGray.GrayAt(0, 0).Y != 0 {
+		t.Fatal("expected the sub-image's top-left to land at canvas (0,0)")
+	}
+	if gotGray.GrayAt(299, 299).Y != 0 {
+		t.Fatal("expected the full 300x300 sub-image to be drawn from the canvas origin")
+	}
+	if gotGray.GrayAt(400, 400).Y != 255 {
+		t.Fatal("expected pixels past the sub-image's own size to stay white")
+	}
+}
+
+func TestEncodeWithHeaderDecodes(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, width, height))
+
+	var buf bytes.Buffer
+	e := Encoder{WriteHeader: true, FileName: "test.mac"}
+	if err := e.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Decode(&buf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecodeRejectsBadCRC(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, width, height))
+
+	var buf bytes.Buffer
+	e := Encoder{WriteHeader: true, FileName: "test.mac"}
+	if err := e.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+	corrupted := buf.Bytes()
+	corrupted[125] ^= 0xFF
+
+	if _, err := Decode(bytes.NewReader(corrupted)); err == nil {
+		t.Fatal("expected an error for a corrupted MacBinary CRC")
+	}
+	if _, err := DecodeWithOptions(bytes.NewReader(corrupted), DecodeOptions{SkipCRC: true}); err != nil {
+		t.Fatalf("expected SkipCRC to tolerate the corrupted CRC, got %v", err)
+	}
+}
+
+func TestEncodePartialPatternsFallBackToDefault(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, width, height))
+
+	var e Encoder
+	e.Patterns[0] = image.NewGray(image.Rect(0, 0, 8, 8))
+	for i := range e.Patterns[0].Pix {
+		e.Patterns[0].Pix[i] = 255
+	}
+	// Patterns[1:] are left nil.
+
+	var buf bytes.Buffer
+	if err := e.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	pats, err := Patterns(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DefaultPatterns()
+	if !bytes.Equal(pats[0].Pix, e.Patterns[0].Pix) {
+		t.Fatal("pattern 0 does not match the explicitly supplied pattern")
+	}
+	for i := 1; i < numPatterns; i++ {
+		if !bytes.Equal(pats[i].Pix, want[i].Pix) {
+			t.Fatalf("pattern %d did not fall back to DefaultPatterns", i)
+		}
+	}
+}
+
+func TestPatternsRoundTrip(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, width, height))
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	pats, err := Patterns(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DefaultPatterns()
+	for i := range pats {
+		if !bytes.Equal(pats[i].Pix, want[i].Pix) {
+			t.Fatalf("pattern %d does not match DefaultPatterns", i)
+		}
+	}
+}
+
+func TestDecodeWithOptionsAsPaletted(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if (x/8+y/8)%2 == 0 {
+				src.SetGray(x, y, color.Gray{Y: 0})
+			} else {
+				src.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := DecodeWithOptions(&buf, DecodeOptions{AsPaletted: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pal, ok := got.(*image.Paletted)
+	if !ok {
+		t.Fatalf("DecodeWithOptions returned %T, want *image.Paletted", got)
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			want := src.GrayAt(x, y).Y == 0
+			got := pal.ColorIndexAt(x, y) == 1
+			if want != got {
+				t.Fatalf("pixel (%d,%d): want black=%v, got black=%v", x, y, want, got)
+			}
+		}
+	}
+}
+
+func TestDecodeWithPatterns(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, width, height))
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	img, pats, err := DecodeWithPatterns(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.(*image.Gray).Pix == nil {
+		t.Fatal("expected a decoded image")
+	}
+	if pats[0] == nil {
+		t.Fatal("expected decoded patterns")
+	}
+}